@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jackharrisonsherlock/govend/vend"
+	"github.com/spf13/cobra"
+)
+
+// reconcilePaymentsCmd represents the reconcile-payments command
+var reconcilePaymentsCmd = &cobra.Command{
+	Use:   "reconcile-payments",
+	Short: "Reconcile sale payments against register closures",
+	Long: `
+Cross-checks sale payments against register closures for a date range,
+producing a per register/day/payment-type reconciliation report plus a list
+of anomalies: payments on sales that are OPEN or deleted, payments with no
+matching register, and payments whose register currency doesn't match the
+first register currency found in the batch.
+
+Example:
+vend reconcile-payments -d DOMAINPREFIX -t TOKEN -z Pacific/Auckland -F 2018-03-01 -T 2018-04-01 -o 'OUTLETNAME'
+`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		reconcilePayments()
+	},
+}
+
+var (
+	reconcileTimeZone string
+	reconcileDateFrom string
+	reconcileDateTo   string
+	reconcileOutlet   string
+	reconcileFormat   string
+)
+
+func init() {
+	// Flags
+	reconcilePaymentsCmd.Flags().StringVarP(&reconcileTimeZone, "Timezone", "z", "", "Timezone of the store in zoneinfo format. The default is to try and use the computer's local timezone.")
+	reconcilePaymentsCmd.Flags().StringVarP(&reconcileDateFrom, "DateFrom", "F", "", "Date from (YYYY-MM-DD)")
+	reconcilePaymentsCmd.Flags().StringVarP(&reconcileDateTo, "DateTo", "T", "", "Date to (YYYY-MM-DD)")
+	reconcilePaymentsCmd.Flags().StringVarP(&reconcileOutlet, "Outlet", "o", "", "Outlet to reconcile payments for")
+	reconcilePaymentsCmd.Flags().StringVarP(&reconcileFormat, "format", "f", "csv", "Report format: csv, tsv, xlsx, or json")
+	reconcilePaymentsCmd.MarkFlagRequired("Timezone")
+	reconcilePaymentsCmd.MarkFlagRequired("DateFrom")
+	reconcilePaymentsCmd.MarkFlagRequired("DateTo")
+
+	rootCmd.AddCommand(reconcilePaymentsCmd)
+}
+
+func reconcilePayments() {
+	// Create a new Vend Client
+	vc := vend.NewClient(Token, DomainPrefix, reconcileTimeZone)
+
+	if err := validateDateRange(reconcileDateFrom, reconcileDateTo); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	format, err := parseReportFormat(reconcileFormat)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// Pull data from Vend
+	fmt.Println("Retrieving data from Vend...")
+
+	registers, err := vc.Registers()
+	if err != nil {
+		log.Fatalf("Failed to get registers: %v", err)
+	}
+
+	sales, err := vc.SalesSearch(reconcileDateFrom, reconcileDateTo, reconcileOutlet)
+	if err != nil {
+		fmt.Printf("Error: %s", err)
+		return
+	}
+
+	rows, anomalies := reconcileSalePayments(sales, registers, vc.TimeZone)
+
+	fileName, err := writeReconciliation(format, vc.DomainPrefix, rows, anomalies)
+	if err != nil {
+		log.Fatalf("Failed writing reconciliation report: %v", err)
+	}
+	fmt.Printf("Exported %v reconciliation rows (%v anomalies) to %s", len(rows), len(anomalies), fileName)
+}
+
+// ReconciliationRow is the payment total (positive amounts), refund total
+// (negative amounts) and number of sales for one register, on one day, for
+// one payment type.
+type ReconciliationRow struct {
+	Register      string
+	Day           string
+	PaymentType   string
+	ExpectedTotal float64
+	RefundTotal   float64
+	SaleCount     int
+}
+
+// PaymentAnomaly flags a single payment that couldn't be reconciled with
+// confidence.
+type PaymentAnomaly struct {
+	InvoiceNumber string
+	Register      string
+	Day           string
+	PaymentType   string
+	Amount        float64
+	Reason        string
+}
+
+// reconcileSalePayments aggregates payment amounts per register/day/
+// payment-type across sales, and flags anomalous payments separately.
+// Payments on open or deleted sales are left out of the totals; payments
+// with no matching register (bucketed under "<Unknown Register>") or with a
+// currency mismatch are flagged and still counted in the totals.
+func reconcileSalePayments(sales []vend.Sale, registers []vend.Register, timeZone string) ([]ReconciliationRow, []PaymentAnomaly) {
+	type bucketKey struct {
+		register, day, paymentType string
+	}
+
+	rows := make(map[bucketKey]*ReconciliationRow)
+	var order []bucketKey
+	seenSales := make(map[bucketKey]map[string]bool)
+
+	var anomalies []PaymentAnomaly
+
+	// The batch should all be in the same currency; take the first one we
+	// see as the expected currency and flag any sale that disagrees.
+	var expectedCurrency string
+	for _, sale := range sales {
+		if register, found := findRegister(sale, registers); found {
+			if currency := registerCurrency(register); currency != "" {
+				expectedCurrency = currency
+				break
+			}
+		}
+	}
+
+	for _, sale := range sales {
+		if sale.Payments == nil {
+			continue
+		}
+
+		register, found := findRegister(sale, registers)
+		registerName := "<Unknown Register>"
+		if found {
+			registerName = *register.Name
+		}
+
+		day := saleDay(sale, timeZone)
+
+		var invoiceNumber string
+		if sale.InvoiceNumber != nil {
+			invoiceNumber = *sale.InvoiceNumber
+		}
+
+		openOrDeleted := sale.DeletedAt != nil || (sale.Status != nil && *sale.Status == "OPEN")
+
+		for _, payment := range *sale.Payments {
+			amount := *payment.Amount
+			paymentType := *payment.Name
+
+			switch {
+			case openOrDeleted:
+				anomalies = append(anomalies, PaymentAnomaly{
+					InvoiceNumber: invoiceNumber, Register: registerName, Day: day,
+					PaymentType: paymentType, Amount: amount, Reason: openOrDeletedReason(sale),
+				})
+				continue
+			case !found:
+				anomalies = append(anomalies, PaymentAnomaly{
+					InvoiceNumber: invoiceNumber, Register: registerName, Day: day,
+					PaymentType: paymentType, Amount: amount, Reason: "no matching register",
+				})
+			case found && expectedCurrency != "" && registerCurrency(register) != "" && registerCurrency(register) != expectedCurrency:
+				anomalies = append(anomalies, PaymentAnomaly{
+					InvoiceNumber: invoiceNumber, Register: registerName, Day: day,
+					PaymentType: paymentType, Amount: amount,
+					Reason: fmt.Sprintf("currency mismatch: expected %s, got %s", expectedCurrency, registerCurrency(register)),
+				})
+			}
+
+			key := bucketKey{registerName, day, paymentType}
+			row, ok := rows[key]
+			if !ok {
+				row = &ReconciliationRow{Register: registerName, Day: day, PaymentType: paymentType}
+				rows[key] = row
+				order = append(order, key)
+				seenSales[key] = make(map[string]bool)
+			}
+
+			if amount < 0 {
+				row.RefundTotal += amount
+			} else {
+				row.ExpectedTotal += amount
+			}
+			if !seenSales[key][invoiceNumber] {
+				seenSales[key][invoiceNumber] = true
+				row.SaleCount++
+			}
+		}
+	}
+
+	reconciliation := make([]ReconciliationRow, 0, len(order))
+	for _, key := range order {
+		reconciliation = append(reconciliation, *rows[key])
+	}
+	return reconciliation, anomalies
+}
+
+// findRegister looks up the register a sale was rung up on.
+func findRegister(sale vend.Sale, registers []vend.Register) (*vend.Register, bool) {
+	if sale.RegisterID == nil {
+		return nil, false
+	}
+	for i := range registers {
+		if *registers[i].ID == *sale.RegisterID {
+			return &registers[i], true
+		}
+	}
+	return nil, false
+}
+
+// saleDay returns the sale date, without the time, in timeZone.
+func saleDay(sale vend.Sale, timeZone string) string {
+	if sale.SaleDate == nil {
+		return ""
+	}
+	dateTimeInLocation := vend.ParseVendDT(*sale.SaleDate, timeZone)
+	return dateTimeInLocation.String()[0:10]
+}
+
+// registerCurrency returns the currency code configured for a register, or
+// an empty string if that information isn't available. Vend stores are
+// usually single-currency, but multi-currency outlets are configured at the
+// register, so a mismatch here generally means a sale was attributed to the
+// wrong outlet.
+func registerCurrency(register *vend.Register) string {
+	if register == nil || register.Currency == nil {
+		return ""
+	}
+	return *register.Currency
+}
+
+// openOrDeletedReason explains why a sale was excluded from reconciliation
+// totals.
+func openOrDeletedReason(sale vend.Sale) string {
+	if sale.DeletedAt != nil {
+		return "sale deleted"
+	}
+	return "sale open"
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tealeg/xlsx"
+)
+
+var reconciliationHeader = []string{"Register", "Day", "Payment Type", "Expected Total", "Refund Total", "Sale Count"}
+var anomalyHeader = []string{"Invoice Number", "Register", "Day", "Payment Type", "Amount", "Reason"}
+
+// writeReconciliation writes the reconciliation rows and anomalies to a
+// report file named after domainPrefix in the requested format, and returns
+// the file's name.
+func writeReconciliation(format ReportFormat, domainPrefix string, rows []ReconciliationRow, anomalies []PaymentAnomaly) (string, error) {
+	fileName := fmt.Sprintf("%s_payment_reconciliation_%v.%s", domainPrefix, time.Now().Unix(), format)
+
+	switch format {
+	case FormatCSV:
+		return fileName, writeReconciliationDelimited(fileName, ',', rows, anomalies)
+	case FormatTSV:
+		return fileName, writeReconciliationDelimited(fileName, '\t', rows, anomalies)
+	case FormatXLSX:
+		return fileName, writeReconciliationXLSX(fileName, rows, anomalies)
+	case FormatJSON:
+		return fileName, writeReconciliationJSON(fileName, rows, anomalies)
+	default:
+		return "", fmt.Errorf("unsupported format: %q", format)
+	}
+}
+
+func reconciliationRecord(row ReconciliationRow) []string {
+	return []string{
+		row.Register, row.Day, row.PaymentType,
+		formatFloat(row.ExpectedTotal), formatFloat(row.RefundTotal),
+		fmt.Sprintf("%d", row.SaleCount),
+	}
+}
+
+func anomalyRecord(anomaly PaymentAnomaly) []string {
+	return []string{
+		anomaly.InvoiceNumber, anomaly.Register, anomaly.Day, anomaly.PaymentType,
+		formatFloat(anomaly.Amount), anomaly.Reason,
+	}
+}
+
+// writeReconciliationDelimited writes the reconciliation rows, followed by a
+// blank line and the anomalies, to a single CSV or TSV file.
+func writeReconciliationDelimited(fileName string, comma rune, rows []ReconciliationRow, anomalies []PaymentAnomaly) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", fileName, err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Comma = comma
+
+	if err := writer.Write(reconciliationHeader); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := writer.Write(reconciliationRecord(row)); err != nil {
+			return err
+		}
+	}
+
+	writer.Write([]string{})
+	if err := writer.Write(anomalyHeader); err != nil {
+		return err
+	}
+	for _, anomaly := range anomalies {
+		if err := writer.Write(anomalyRecord(anomaly)); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeReconciliationXLSX(fileName string, rows []ReconciliationRow, anomalies []PaymentAnomaly) error {
+	file := xlsx.NewFile()
+
+	reconciliationSheet, err := file.AddSheet("Reconciliation")
+	if err != nil {
+		return fmt.Errorf("error creating Reconciliation sheet: %w", err)
+	}
+	writeXLSXRow(reconciliationSheet, reconciliationHeader)
+	for _, row := range rows {
+		writeXLSXRow(reconciliationSheet, reconciliationRecord(row))
+	}
+
+	anomaliesSheet, err := file.AddSheet("Anomalies")
+	if err != nil {
+		return fmt.Errorf("error creating Anomalies sheet: %w", err)
+	}
+	writeXLSXRow(anomaliesSheet, anomalyHeader)
+	for _, anomaly := range anomalies {
+		writeXLSXRow(anomaliesSheet, anomalyRecord(anomaly))
+	}
+
+	return file.Save(fileName)
+}
+
+type reconciliationEnvelope struct {
+	Rows      []ReconciliationRow `json:"rows"`
+	Anomalies []PaymentAnomaly    `json:"anomalies"`
+}
+
+func writeReconciliationJSON(fileName string, rows []ReconciliationRow, anomalies []PaymentAnomaly) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", fileName, err)
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(reconciliationEnvelope{Rows: rows, Anomalies: anomalies})
+}
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jackharrisonsherlock/govend/vend"
+)
+
+func baseReconcileSale() vend.Sale {
+	return vend.Sale{
+		SaleDate:      strp("2023-06-01T10:15:30+00:00"),
+		InvoiceNumber: strp("INV-1"),
+		RegisterID:    strp("reg-1"),
+		Status:        strp("CLOSED"),
+		Payments: &[]vend.Payment{
+			{Name: strp("Cash"), Amount: f64p(100)},
+		},
+	}
+}
+
+func baseReconcileRegisters() []vend.Register {
+	return []vend.Register{{ID: strp("reg-1"), Name: strp("Front Counter")}}
+}
+
+func TestReconcileSalePayments_ClosedSaleAggregatesExpectedTotal(t *testing.T) {
+	sale := baseReconcileSale()
+	registers := baseReconcileRegisters()
+
+	rows, anomalies := reconcileSalePayments([]vend.Sale{sale}, registers, "Pacific/Auckland")
+
+	if len(anomalies) != 0 {
+		t.Fatalf("got %d anomalies, want 0: %+v", len(anomalies), anomalies)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("got %d rows, want 1", len(rows))
+	}
+	row := rows[0]
+	if row.ExpectedTotal != 100 {
+		t.Errorf("expected total = %v, want 100", row.ExpectedTotal)
+	}
+	if row.RefundTotal != 0 {
+		t.Errorf("refund total = %v, want 0", row.RefundTotal)
+	}
+	if row.SaleCount != 1 {
+		t.Errorf("sale count = %d, want 1", row.SaleCount)
+	}
+}
+
+func TestReconcileSalePayments_RefundAggregatesSeparately(t *testing.T) {
+	sale := baseReconcileSale()
+	(*sale.Payments)[0].Amount = f64p(-100)
+	registers := baseReconcileRegisters()
+
+	rows, anomalies := reconcileSalePayments([]vend.Sale{sale}, registers, "Pacific/Auckland")
+
+	if len(anomalies) != 0 {
+		t.Fatalf("got %d anomalies, want 0: %+v", len(anomalies), anomalies)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("got %d rows, want 1", len(rows))
+	}
+	row := rows[0]
+	if row.RefundTotal != -100 {
+		t.Errorf("refund total = %v, want -100", row.RefundTotal)
+	}
+	if row.ExpectedTotal != 0 {
+		t.Errorf("expected total = %v, want 0", row.ExpectedTotal)
+	}
+}
+
+func TestReconcileSalePayments_OpenSaleFlaggedAndExcluded(t *testing.T) {
+	sale := baseReconcileSale()
+	sale.Status = strp("OPEN")
+	registers := baseReconcileRegisters()
+
+	rows, anomalies := reconcileSalePayments([]vend.Sale{sale}, registers, "Pacific/Auckland")
+
+	if len(rows) != 0 {
+		t.Fatalf("got %d rows, want 0 (open sale should be excluded from totals)", len(rows))
+	}
+	if len(anomalies) != 1 {
+		t.Fatalf("got %d anomalies, want 1", len(anomalies))
+	}
+	if anomalies[0].Reason != "sale open" {
+		t.Errorf("reason = %q, want %q", anomalies[0].Reason, "sale open")
+	}
+}
+
+func TestReconcileSalePayments_DeletedSaleFlaggedAndExcluded(t *testing.T) {
+	sale := baseReconcileSale()
+	sale.DeletedAt = timep(time.Now())
+	registers := baseReconcileRegisters()
+
+	rows, anomalies := reconcileSalePayments([]vend.Sale{sale}, registers, "Pacific/Auckland")
+
+	if len(rows) != 0 {
+		t.Fatalf("got %d rows, want 0 (deleted sale should be excluded from totals)", len(rows))
+	}
+	if len(anomalies) != 1 {
+		t.Fatalf("got %d anomalies, want 1", len(anomalies))
+	}
+	if anomalies[0].Reason != "sale deleted" {
+		t.Errorf("reason = %q, want %q", anomalies[0].Reason, "sale deleted")
+	}
+}
+
+func TestReconcileSalePayments_UnmatchedRegisterFlagged(t *testing.T) {
+	sale := baseReconcileSale()
+	sale.RegisterID = strp("reg-does-not-exist")
+	registers := baseReconcileRegisters()
+
+	rows, anomalies := reconcileSalePayments([]vend.Sale{sale}, registers, "Pacific/Auckland")
+
+	if len(anomalies) != 1 {
+		t.Fatalf("got %d anomalies, want 1", len(anomalies))
+	}
+	if anomalies[0].Reason != "no matching register" {
+		t.Errorf("reason = %q, want %q", anomalies[0].Reason, "no matching register")
+	}
+	// An unmatched register is still bucketed under "<Unknown Register>" so the
+	// payment isn't silently dropped from the reconciliation rows.
+	if len(rows) != 1 {
+		t.Fatalf("got %d rows, want 1", len(rows))
+	}
+	if rows[0].Register != "<Unknown Register>" {
+		t.Errorf("register = %q, want %q", rows[0].Register, "<Unknown Register>")
+	}
+}
+
+func TestReconcileSalePayments_CurrencyMismatchFlagged(t *testing.T) {
+	saleA := baseReconcileSale()
+	saleB := baseReconcileSale()
+	saleB.InvoiceNumber = strp("INV-2")
+	saleB.RegisterID = strp("reg-2")
+
+	registers := []vend.Register{
+		{ID: strp("reg-1"), Name: strp("Front Counter"), Currency: strp("USD")},
+		{ID: strp("reg-2"), Name: strp("Back Counter"), Currency: strp("NZD")},
+	}
+
+	rows, anomalies := reconcileSalePayments([]vend.Sale{saleA, saleB}, registers, "Pacific/Auckland")
+
+	if len(anomalies) != 1 {
+		t.Fatalf("got %d anomalies, want 1: %+v", len(anomalies), anomalies)
+	}
+	if anomalies[0].InvoiceNumber != "INV-2" {
+		t.Errorf("anomaly invoice = %q, want INV-2", anomalies[0].InvoiceNumber)
+	}
+	want := "currency mismatch: expected USD, got NZD"
+	if anomalies[0].Reason != want {
+		t.Errorf("reason = %q, want %q", anomalies[0].Reason, want)
+	}
+	// Unlike open/deleted sales, a currency mismatch is flagged but still
+	// rolled into its own register's totals, one row per register.
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(rows))
+	}
+}
+
+func TestReconcileSalePayments_SameSaleMultiplePaymentsCountedOnce(t *testing.T) {
+	sale := baseReconcileSale()
+	*sale.Payments = append(*sale.Payments, vend.Payment{Name: strp("Cash"), Amount: f64p(20)})
+	registers := baseReconcileRegisters()
+
+	rows, _ := reconcileSalePayments([]vend.Sale{sale}, registers, "Pacific/Auckland")
+
+	if len(rows) != 1 {
+		t.Fatalf("got %d rows, want 1", len(rows))
+	}
+	if rows[0].SaleCount != 1 {
+		t.Errorf("sale count = %d, want 1 (same sale, two payments)", rows[0].SaleCount)
+	}
+	if rows[0].ExpectedTotal != 120 {
+		t.Errorf("expected total = %v, want 120", rows[0].ExpectedTotal)
+	}
+}
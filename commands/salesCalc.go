@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jackharrisonsherlock/govend/vend"
+)
+
+// SaleReport is a fully denormalized, ready-to-render view of a single sale:
+// customer, register, and user names are already resolved, and totals are
+// already computed, so renderers don't need the original lookup tables.
+type SaleReport struct {
+	Header   SaleHeader
+	Lines    []LineReport
+	Payments []PaymentReport
+}
+
+// SaleHeader holds the sale-level fields and totals.
+type SaleHeader struct {
+	SaleDate            string
+	SaleTime            string
+	InvoiceNumber       string
+	CustomerCode        string
+	CustomerCompanyName string
+	CustomerName        string
+	Note                string
+	TotalQuantity       float64
+	Subtotal            float64
+	Tax                 float64
+	Discount            float64
+	Loyalty             float64
+	Total               float64
+	Details             string
+	Register            string
+	User                string
+	Status              string
+}
+
+// LineReport holds a single sale line item, with its product resolved.
+type LineReport struct {
+	Quantity      float64
+	Price         float64
+	Tax           float64
+	Discount      float64
+	DiscountTotal float64
+	Loyalty       float64
+	Total         float64
+	ProductName   string
+	ProductSKU    string
+}
+
+// PaymentReport holds a single payment against a sale.
+type PaymentReport struct {
+	Name   string
+	Amount float64
+}
+
+// calculateSalesReport denormalizes sales into SaleReports, resolving
+// customer, register, user, and product lookups and computing totals along
+// the way. Deleted sales and sales with a status of "OPEN" are excluded, to
+// match the behaviour of Vend's own sales history export.
+func calculateSalesReport(registers []vend.Register, users []vend.User, customers []vend.Customer,
+	products []vend.Product, sales []vend.Sale, timeZone string) []SaleReport {
+
+	var reports []SaleReport
+	for _, sale := range sales {
+		if sale.DeletedAt != nil {
+			continue
+		}
+		if sale.Status != nil && *sale.Status == "OPEN" {
+			continue
+		}
+		reports = append(reports, calculateSaleReport(sale, registers, users, customers, products, timeZone))
+	}
+	return reports
+}
+
+// calculateSaleReport denormalizes a single sale.
+func calculateSaleReport(sale vend.Sale, registers []vend.Register, users []vend.User,
+	customers []vend.Customer, products []vend.Product, timeZone string) SaleReport {
+
+	dateTimeInLocation := vend.ParseVendDT(*sale.SaleDate, timeZone)
+	dateTimeStr := dateTimeInLocation.String()[0:19]
+	dateStr := dateTimeStr[0:10]
+	timeStr := dateTimeStr[10:19]
+
+	var invoiceNumber string
+	if sale.InvoiceNumber != nil {
+		invoiceNumber = *sale.InvoiceNumber
+	}
+
+	var note string
+	if sale.Note != nil {
+		note = *sale.Note
+	}
+
+	customerCode, customerCompanyName, customerName := lookupCustomer(sale, customers)
+	registerName := lookupRegister(sale, registers)
+	userName := lookupUser(sale, users)
+
+	var status string
+	if sale.Status != nil {
+		status = *sale.Status
+	}
+
+	var totalQuantity, totalDiscount float64
+	var saleItems []string
+	var lines []LineReport
+	for _, lineitem := range *sale.LineItems {
+		totalQuantity += *lineitem.Quantity
+		totalDiscount += *lineitem.DiscountTotal
+
+		plainName, variantName, productSKU := lookupProduct(*lineitem.ProductID, products)
+		if plainName != "" {
+			saleItems = append(saleItems, fmt.Sprintf("%v X %s", *lineitem.Quantity, plainName))
+		}
+
+		lines = append(lines, LineReport{
+			Quantity:      *lineitem.Quantity,
+			Price:         *lineitem.Price,
+			Tax:           *lineitem.Tax,
+			Discount:      *lineitem.Discount,
+			DiscountTotal: *lineitem.DiscountTotal,
+			Loyalty:       *lineitem.LoyaltyValue,
+			Total:         (*lineitem.Price + *lineitem.Tax) * *lineitem.Quantity,
+			ProductName:   variantName,
+			ProductSKU:    productSKU,
+		})
+	}
+
+	var payments []PaymentReport
+	for _, payment := range *sale.Payments {
+		payments = append(payments, PaymentReport{
+			Name:   *payment.Name,
+			Amount: *payment.Amount,
+		})
+	}
+
+	return SaleReport{
+		Header: SaleHeader{
+			SaleDate:            dateStr,
+			SaleTime:            timeStr,
+			InvoiceNumber:       invoiceNumber,
+			CustomerCode:        customerCode,
+			CustomerCompanyName: customerCompanyName,
+			CustomerName:        customerName,
+			Note:                note,
+			TotalQuantity:       totalQuantity,
+			Subtotal:            *sale.TotalPrice,
+			Tax:                 *sale.TotalTax,
+			Discount:            totalDiscount,
+			Loyalty:             *sale.TotalLoyalty,
+			Total:               *sale.TotalPrice + *sale.TotalTax,
+			Details:             strings.Join(saleItems, " + "),
+			Register:            registerName,
+			User:                userName,
+			Status:              status,
+		},
+		Lines:    lines,
+		Payments: payments,
+	}
+}
+
+// lookupCustomer returns the code, company name, and full name of the
+// customer attached to sale, or empty strings if it has no customer or the
+// customer can't be found (e.g. it was removed).
+func lookupCustomer(sale vend.Sale, customers []vend.Customer) (code, companyName, name string) {
+	if sale.CustomerID == nil {
+		return "", "", ""
+	}
+	for _, customer := range customers {
+		if *customer.ID != *sale.CustomerID {
+			continue
+		}
+		var fullName []string
+		if customer.FirstName != nil {
+			fullName = append(fullName, *customer.FirstName)
+		}
+		if customer.LastName != nil {
+			fullName = append(fullName, *customer.LastName)
+		}
+		if customer.Code != nil {
+			code = *customer.Code
+		}
+		if customer.CompanyName != nil {
+			companyName = *customer.CompanyName
+		}
+		name = strings.Join(fullName, " ")
+		break
+	}
+	return code, companyName, name
+}
+
+// lookupRegister returns the name of the register the sale was rung up on,
+// annotating deleted registers, or "<Deleted Register>" if the register no
+// longer appears in the registers list at all.
+func lookupRegister(sale vend.Sale, registers []vend.Register) string {
+	for _, register := range registers {
+		if sale.RegisterID == nil || *sale.RegisterID != *register.ID {
+			continue
+		}
+		name := *register.Name
+		if register.DeletedAt != nil {
+			name += " (Deleted)"
+		}
+		return name
+	}
+	return "<Deleted Register>"
+}
+
+// lookupUser returns the display name of the user who made the sale, or an
+// empty string if the sale has no user or the user can't be found.
+func lookupUser(sale vend.Sale, users []vend.User) string {
+	if sale.UserID == nil {
+		return ""
+	}
+	for _, user := range users {
+		if *sale.UserID == *user.ID {
+			return *user.DisplayName
+		}
+	}
+	return ""
+}
+
+// lookupProduct returns the plain name, variant name, and SKU of the product
+// with the given ID, or empty strings if it can't be found.
+func lookupProduct(productID string, products []vend.Product) (name, variantName, sku string) {
+	for _, product := range products {
+		if *product.ID == productID {
+			if product.Name != nil {
+				name = *product.Name
+			}
+			if product.VariantName != nil {
+				variantName = *product.VariantName
+			}
+			if product.SKU != nil {
+				sku = *product.SKU
+			}
+			break
+		}
+	}
+	return name, variantName, sku
+}
@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jackharrisonsherlock/govend/vend"
+)
+
+func strp(s string) *string        { return &s }
+func f64p(f float64) *float64      { return &f }
+func timep(t time.Time) *time.Time { return &t }
+
+// baseSale returns a minimal sale with one line item and one payment, whose
+// register/customer/user/product IDs match baseLookups, so each test case can
+// tweak exactly the field it cares about.
+func baseSale() vend.Sale {
+	return vend.Sale{
+		SaleDate:      strp("2023-06-01T10:15:30+00:00"),
+		InvoiceNumber: strp("INV-1"),
+		CustomerID:    strp("cust-1"),
+		RegisterID:    strp("reg-1"),
+		UserID:        strp("user-1"),
+		Status:        strp("CLOSED"),
+		TotalPrice:    f64p(100),
+		TotalTax:      f64p(15),
+		TotalLoyalty:  f64p(0),
+		LineItems: &[]vend.SaleLineItem{
+			{
+				ProductID:     strp("prod-1"),
+				Quantity:      f64p(2),
+				Price:         f64p(50),
+				Tax:           f64p(7.5),
+				Discount:      f64p(0),
+				DiscountTotal: f64p(0),
+				LoyaltyValue:  f64p(0),
+			},
+		},
+		Payments: &[]vend.Payment{
+			{Name: strp("Cash"), Amount: f64p(115)},
+		},
+	}
+}
+
+func baseLookups() (registers []vend.Register, users []vend.User, customers []vend.Customer, products []vend.Product) {
+	registers = []vend.Register{{ID: strp("reg-1"), Name: strp("Front Counter")}}
+	users = []vend.User{{ID: strp("user-1"), DisplayName: strp("Jane Smith")}}
+	customers = []vend.Customer{{ID: strp("cust-1"), FirstName: strp("John"), LastName: strp("Doe"), Code: strp("JD1"), CompanyName: strp("Acme")}}
+	products = []vend.Product{{ID: strp("prod-1"), Name: strp("Widget"), VariantName: strp("Widget - Red"), SKU: strp("SKU-1")}}
+	return registers, users, customers, products
+}
+
+func TestCalculateSaleReport_Rounding(t *testing.T) {
+	sale := baseSale()
+	var price, tax, quantity float64 = 19.99, 1.0 / 3, 3
+	(*sale.LineItems)[0].Price = f64p(price)
+	(*sale.LineItems)[0].Tax = f64p(tax)
+	(*sale.LineItems)[0].Quantity = f64p(quantity)
+
+	registers, users, customers, products := baseLookups()
+	report := calculateSaleReport(sale, registers, users, customers, products, "Pacific/Auckland")
+
+	line := report.Lines[0]
+	wantTotal := (price + tax) * quantity
+	if line.Total != wantTotal {
+		t.Errorf("line total = %v, want %v", line.Total, wantTotal)
+	}
+}
+
+func TestCalculateSaleReport_NegativeQuantityRefund(t *testing.T) {
+	sale := baseSale()
+	(*sale.LineItems)[0].Quantity = f64p(-1)
+	(*sale.LineItems)[0].DiscountTotal = f64p(-5)
+	sale.TotalPrice = f64p(-50)
+	sale.TotalTax = f64p(-7.5)
+
+	registers, users, customers, products := baseLookups()
+	report := calculateSaleReport(sale, registers, users, customers, products, "Pacific/Auckland")
+
+	if report.Header.TotalQuantity != -1 {
+		t.Errorf("total quantity = %v, want -1", report.Header.TotalQuantity)
+	}
+	if report.Header.Discount != -5 {
+		t.Errorf("discount = %v, want -5", report.Header.Discount)
+	}
+	if report.Header.Total != -57.5 {
+		t.Errorf("total = %v, want -57.5", report.Header.Total)
+	}
+}
+
+func TestCalculateSaleReport_DeletedRegister(t *testing.T) {
+	sale := baseSale()
+	registers, users, customers, products := baseLookups()
+	registers[0].DeletedAt = timep(time.Now())
+
+	report := calculateSaleReport(sale, registers, users, customers, products, "Pacific/Auckland")
+
+	want := "Front Counter (Deleted)"
+	if report.Header.Register != want {
+		t.Errorf("register = %q, want %q", report.Header.Register, want)
+	}
+}
+
+func TestCalculateSaleReport_UnknownRegister(t *testing.T) {
+	sale := baseSale()
+	sale.RegisterID = strp("reg-does-not-exist")
+	registers, users, customers, products := baseLookups()
+
+	report := calculateSaleReport(sale, registers, users, customers, products, "Pacific/Auckland")
+
+	want := "<Deleted Register>"
+	if report.Header.Register != want {
+		t.Errorf("register = %q, want %q", report.Header.Register, want)
+	}
+}
+
+func TestCalculateSaleReport_MissingCustomerID(t *testing.T) {
+	sale := baseSale()
+	sale.CustomerID = nil
+	registers, users, customers, products := baseLookups()
+
+	report := calculateSaleReport(sale, registers, users, customers, products, "Pacific/Auckland")
+
+	if report.Header.CustomerName != "" || report.Header.CustomerCode != "" {
+		t.Errorf("expected empty customer fields, got name=%q code=%q", report.Header.CustomerName, report.Header.CustomerCode)
+	}
+}
+
+func TestCalculateSalesReport_ExcludesDeletedAndOpenSales(t *testing.T) {
+	closedSale := baseSale()
+	deletedSale := baseSale()
+	deletedSale.DeletedAt = timep(time.Now())
+	openSale := baseSale()
+	openSale.Status = strp("OPEN")
+
+	registers, users, customers, products := baseLookups()
+	reports := calculateSalesReport(registers, users, customers, products,
+		[]vend.Sale{closedSale, deletedSale, openSale}, "Pacific/Auckland")
+
+	if len(reports) != 1 {
+		t.Fatalf("got %d reports, want 1", len(reports))
+	}
+}
@@ -0,0 +1,356 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tealeg/xlsx"
+)
+
+// ReportFormat is an output format supported by export-sales.
+type ReportFormat string
+
+// Supported report formats.
+const (
+	FormatCSV  ReportFormat = "csv"
+	FormatTSV  ReportFormat = "tsv"
+	FormatXLSX ReportFormat = "xlsx"
+	FormatJSON ReportFormat = "json"
+)
+
+// parseReportFormat validates the value of the --format flag.
+func parseReportFormat(format string) (ReportFormat, error) {
+	switch f := ReportFormat(strings.ToLower(format)); f {
+	case FormatCSV, FormatTSV, FormatXLSX, FormatJSON:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unsupported format: %q (expected csv, tsv, xlsx, or json)", format)
+	}
+}
+
+// delimitedHeader is the flattened header row shared by the CSV and TSV
+// renderers. Each sale is written as a "Sale" row, followed by one "Sale
+// Line" row per line item and one "Payment" row per payment.
+var delimitedHeader = []string{
+	"Sale Date", "Sale Time", "Invoice Number", "Line Type", "Customer Code",
+	"Company Name", "Customer Name", "Sale Note", "Quantity", "Price", "Tax",
+	"Discount", "Loyalty", "Total", "Paid", "Details", "Register", "User",
+	"Status", "Product Sku",
+}
+
+// SalesRenderer writes a sales export to a destination file in a specific
+// format. Sales are streamed in one at a time via WriteSale.
+type SalesRenderer interface {
+	// WriteHeader writes any header row(s) needed before the first sale.
+	WriteHeader() error
+	// WriteSale writes a single sale, its line items, and its payments.
+	WriteSale(report SaleReport) error
+	// Close flushes and closes the destination file, returning its name.
+	Close() (string, error)
+}
+
+// newSalesRenderer creates a report file named after domainPrefix and the
+// current time, with a suffix appropriate for format, and returns a
+// SalesRenderer that writes to it.
+func newSalesRenderer(format ReportFormat, domainPrefix string) (SalesRenderer, error) {
+	fileName := fmt.Sprintf("%s_sales_history_%v.%s", domainPrefix, time.Now().Unix(), format)
+
+	switch format {
+	case FormatCSV:
+		return newDelimitedRenderer(fileName, ',')
+	case FormatTSV:
+		return newDelimitedRenderer(fileName, '\t')
+	case FormatXLSX:
+		return newXLSXRenderer(fileName)
+	case FormatJSON:
+		return newJSONRenderer(fileName)
+	default:
+		return nil, fmt.Errorf("unsupported format: %q", format)
+	}
+}
+
+// formatFloat renders f the same way the original CSV export did: the
+// shortest decimal representation that round-trips back to f.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// delimitedRenderer renders sales as flattened CSV or TSV rows, depending on
+// the delimiter it's constructed with.
+type delimitedRenderer struct {
+	file   *os.File
+	writer *csv.Writer
+}
+
+// newDelimitedRenderer opens fileName and returns a renderer that writes to
+// it using comma as the field delimiter.
+func newDelimitedRenderer(fileName string, comma rune) (*delimitedRenderer, error) {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s: %w", fileName, err)
+	}
+
+	writer := csv.NewWriter(file)
+	writer.Comma = comma
+
+	return &delimitedRenderer{file: file, writer: writer}, nil
+}
+
+func (r *delimitedRenderer) WriteHeader() error {
+	return r.writer.Write(delimitedHeader)
+}
+
+func (r *delimitedRenderer) WriteSale(report SaleReport) error {
+	h := report.Header
+
+	saleRecord := []string{
+		h.SaleDate, h.SaleTime, h.InvoiceNumber, "Sale", h.CustomerCode,
+		h.CustomerCompanyName, h.CustomerName, h.Note, formatFloat(h.TotalQuantity),
+		formatFloat(h.Subtotal), formatFloat(h.Tax), formatFloat(h.Discount),
+		formatFloat(h.Loyalty), formatFloat(h.Total), "", h.Details, h.Register,
+		h.User, h.Status, "",
+	}
+	if err := r.writer.Write(saleRecord); err != nil {
+		return err
+	}
+
+	for _, line := range report.Lines {
+		lineRecord := []string{
+			h.SaleDate, h.SaleTime, "", "Sale Line", "", "", "", "",
+			formatFloat(line.Quantity), formatFloat(line.Price), formatFloat(line.Tax),
+			formatFloat(line.Discount), formatFloat(line.Loyalty), formatFloat(line.Total),
+			"", line.ProductName, "", "", "", line.ProductSKU,
+		}
+		if err := r.writer.Write(lineRecord); err != nil {
+			return err
+		}
+	}
+
+	for _, payment := range report.Payments {
+		paymentRecord := []string{
+			h.SaleDate, h.SaleTime, "", "Payment", "", "", "", "", "", "", "",
+			"", "", "", formatFloat(payment.Amount), payment.Name, "", "", "", "",
+		}
+		if err := r.writer.Write(paymentRecord); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *delimitedRenderer) Close() (string, error) {
+	r.writer.Flush()
+	name := r.file.Name()
+	if err := r.writer.Error(); err != nil {
+		r.file.Close()
+		return name, err
+	}
+	return name, r.file.Close()
+}
+
+// Sheet headers for the XLSX renderer. Unlike the flattened CSV/TSV layout,
+// each sheet only carries the columns relevant to its row type.
+var (
+	salesSheetHeader     = []string{"Sale Date", "Sale Time", "Invoice Number", "Customer Code", "Company Name", "Customer Name", "Sale Note", "Quantity", "Subtotal", "Tax", "Discount", "Loyalty", "Total", "Details", "Register", "User", "Status"}
+	saleLinesSheetHeader = []string{"Sale Date", "Sale Time", "Invoice Number", "Quantity", "Price", "Tax", "Discount", "Loyalty", "Total", "Product Name", "Product Sku"}
+	paymentsSheetHeader  = []string{"Sale Date", "Sale Time", "Invoice Number", "Payment Name", "Amount"}
+)
+
+// xlsxRenderer renders sales into an XLSX workbook with one sheet each for
+// sales, sale lines, and payments.
+type xlsxRenderer struct {
+	fileName       string
+	file           *xlsx.File
+	salesSheet     *xlsx.Sheet
+	saleLinesSheet *xlsx.Sheet
+	paymentsSheet  *xlsx.Sheet
+}
+
+func newXLSXRenderer(fileName string) (*xlsxRenderer, error) {
+	file := xlsx.NewFile()
+
+	salesSheet, err := file.AddSheet("Sales")
+	if err != nil {
+		return nil, fmt.Errorf("error creating Sales sheet: %w", err)
+	}
+	saleLinesSheet, err := file.AddSheet("Sale Lines")
+	if err != nil {
+		return nil, fmt.Errorf("error creating Sale Lines sheet: %w", err)
+	}
+	paymentsSheet, err := file.AddSheet("Payments")
+	if err != nil {
+		return nil, fmt.Errorf("error creating Payments sheet: %w", err)
+	}
+
+	return &xlsxRenderer{
+		fileName:       fileName,
+		file:           file,
+		salesSheet:     salesSheet,
+		saleLinesSheet: saleLinesSheet,
+		paymentsSheet:  paymentsSheet,
+	}, nil
+}
+
+func (r *xlsxRenderer) WriteHeader() error {
+	writeXLSXRow(r.salesSheet, salesSheetHeader)
+	writeXLSXRow(r.saleLinesSheet, saleLinesSheetHeader)
+	writeXLSXRow(r.paymentsSheet, paymentsSheetHeader)
+	return nil
+}
+
+func (r *xlsxRenderer) WriteSale(report SaleReport) error {
+	h := report.Header
+
+	writeXLSXRow(r.salesSheet, []string{
+		h.SaleDate, h.SaleTime, h.InvoiceNumber, h.CustomerCode, h.CustomerCompanyName,
+		h.CustomerName, h.Note, formatFloat(h.TotalQuantity), formatFloat(h.Subtotal),
+		formatFloat(h.Tax), formatFloat(h.Discount), formatFloat(h.Loyalty),
+		formatFloat(h.Total), h.Details, h.Register, h.User, h.Status,
+	})
+
+	for _, line := range report.Lines {
+		writeXLSXRow(r.saleLinesSheet, []string{
+			h.SaleDate, h.SaleTime, h.InvoiceNumber, formatFloat(line.Quantity),
+			formatFloat(line.Price), formatFloat(line.Tax), formatFloat(line.Discount),
+			formatFloat(line.Loyalty), formatFloat(line.Total), line.ProductName, line.ProductSKU,
+		})
+	}
+
+	for _, payment := range report.Payments {
+		writeXLSXRow(r.paymentsSheet, []string{
+			h.SaleDate, h.SaleTime, h.InvoiceNumber, payment.Name, formatFloat(payment.Amount),
+		})
+	}
+
+	return nil
+}
+
+func writeXLSXRow(sheet *xlsx.Sheet, values []string) {
+	row := sheet.AddRow()
+	for _, value := range values {
+		row.AddCell().SetString(value)
+	}
+}
+
+func (r *xlsxRenderer) Close() (string, error) {
+	return r.fileName, r.file.Save(r.fileName)
+}
+
+// jsonRenderer renders sales as a JSON array, one record-envelope per sale,
+// with its line items and payments nested as arrays rather than flattened.
+type jsonRenderer struct {
+	file    *os.File
+	encoder *json.Encoder
+	wrote   bool
+}
+
+func newJSONRenderer(fileName string) (*jsonRenderer, error) {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s: %w", fileName, err)
+	}
+	return &jsonRenderer{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+func (r *jsonRenderer) WriteHeader() error {
+	_, err := r.file.WriteString("[\n")
+	return err
+}
+
+// saleEnvelope is the nested JSON representation of a single sale.
+type saleEnvelope struct {
+	SaleDate      string                `json:"sale_date"`
+	SaleTime      string                `json:"sale_time"`
+	InvoiceNumber string                `json:"invoice_number"`
+	CustomerCode  string                `json:"customer_code,omitempty"`
+	CustomerName  string                `json:"customer_name,omitempty"`
+	Note          string                `json:"note,omitempty"`
+	Register      string                `json:"register"`
+	User          string                `json:"user,omitempty"`
+	Status        string                `json:"status"`
+	Subtotal      float64               `json:"subtotal"`
+	Tax           float64               `json:"tax"`
+	Discount      float64               `json:"discount"`
+	Loyalty       float64               `json:"loyalty"`
+	Total         float64               `json:"total"`
+	Lines         []saleLineEnvelope    `json:"lines"`
+	Payments      []salePaymentEnvelope `json:"payments"`
+}
+
+type saleLineEnvelope struct {
+	Quantity    float64 `json:"quantity"`
+	Price       float64 `json:"price"`
+	Tax         float64 `json:"tax"`
+	Discount    float64 `json:"discount"`
+	Loyalty     float64 `json:"loyalty"`
+	Total       float64 `json:"total"`
+	ProductName string  `json:"product_name"`
+	ProductSKU  string  `json:"product_sku"`
+}
+
+type salePaymentEnvelope struct {
+	Name   string  `json:"name"`
+	Amount float64 `json:"amount"`
+}
+
+func (r *jsonRenderer) WriteSale(report SaleReport) error {
+	h := report.Header
+
+	envelope := saleEnvelope{
+		SaleDate:      h.SaleDate,
+		SaleTime:      h.SaleTime,
+		InvoiceNumber: h.InvoiceNumber,
+		CustomerCode:  h.CustomerCode,
+		CustomerName:  h.CustomerName,
+		Note:          h.Note,
+		Register:      h.Register,
+		User:          h.User,
+		Status:        h.Status,
+		Subtotal:      h.Subtotal,
+		Tax:           h.Tax,
+		Discount:      h.Discount,
+		Loyalty:       h.Loyalty,
+		Total:         h.Total,
+	}
+	for _, line := range report.Lines {
+		envelope.Lines = append(envelope.Lines, saleLineEnvelope{
+			Quantity:    line.Quantity,
+			Price:       line.Price,
+			Tax:         line.Tax,
+			Discount:    line.Discount,
+			Loyalty:     line.Loyalty,
+			Total:       line.Total,
+			ProductName: line.ProductName,
+			ProductSKU:  line.ProductSKU,
+		})
+	}
+	for _, payment := range report.Payments {
+		envelope.Payments = append(envelope.Payments, salePaymentEnvelope{
+			Name:   payment.Name,
+			Amount: payment.Amount,
+		})
+	}
+
+	if r.wrote {
+		if _, err := r.file.WriteString(",\n"); err != nil {
+			return err
+		}
+	}
+	r.wrote = true
+	return r.encoder.Encode(envelope)
+}
+
+func (r *jsonRenderer) Close() (string, error) {
+	name := r.file.Name()
+	if _, err := r.file.WriteString("]\n"); err != nil {
+		r.file.Close()
+		return name, err
+	}
+	return name, r.file.Close()
+}
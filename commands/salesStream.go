@@ -0,0 +1,249 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jackharrisonsherlock/govend/vend"
+	"github.com/schollz/progressbar/v3"
+)
+
+// dateChunk is an inclusive [From, To] slice of a larger date range.
+type dateChunk struct {
+	From, To string
+}
+
+// chunkDateRange splits [dateFrom, dateTo] into consecutive inclusive slices
+// of at most chunkDays days each, so large exports can be fetched and
+// written incrementally instead of loading every sale into memory at once.
+func chunkDateRange(dateFrom, dateTo string, chunkDays int) ([]dateChunk, error) {
+	layout := "2006-01-02"
+	from, err := time.Parse(layout, dateFrom)
+	if err != nil {
+		return nil, fmt.Errorf("incorrect date from: %v, %v", dateFrom, err)
+	}
+	to, err := time.Parse(layout, dateTo)
+	if err != nil {
+		return nil, fmt.Errorf("incorrect date to: %v, %v", dateTo, err)
+	}
+	if chunkDays < 1 {
+		chunkDays = 1
+	}
+
+	var chunks []dateChunk
+	for cursor := from; !cursor.After(to); cursor = cursor.AddDate(0, 0, chunkDays) {
+		end := cursor.AddDate(0, 0, chunkDays-1)
+		if end.After(to) {
+			end = to
+		}
+		chunks = append(chunks, dateChunk{From: cursor.Format(layout), To: end.Format(layout)})
+	}
+	return chunks, nil
+}
+
+// defaultSalesSearchRatePerSecond is how many Vend SalesSearch requests
+// streamSalesReport will issue per second by default. This is a property of
+// Vend's own API rate limit, not of how many workers the operator chooses
+// to run, so it's deliberately not derived from --workers.
+const defaultSalesSearchRatePerSecond = 2
+
+// tokenBucket rate-limits the number of Vend API requests made per second,
+// so a worker pool doesn't trip Vend's API rate limiting on busy stores.
+type tokenBucket struct {
+	tokens chan struct{}
+	stop   chan struct{}
+}
+
+func newTokenBucket(ratePerSecond int) *tokenBucket {
+	if ratePerSecond < 1 {
+		ratePerSecond = 1
+	}
+	b := &tokenBucket{
+		tokens: make(chan struct{}, ratePerSecond),
+		stop:   make(chan struct{}),
+	}
+	for i := 0; i < ratePerSecond; i++ {
+		b.tokens <- struct{}{}
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Second / time.Duration(ratePerSecond))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				select {
+				case b.tokens <- struct{}{}:
+				default:
+				}
+			case <-b.stop:
+				return
+			}
+		}
+	}()
+	return b
+}
+
+// Take blocks until a token is available.
+func (b *tokenBucket) Take() {
+	<-b.tokens
+}
+
+func (b *tokenBucket) Close() {
+	close(b.stop)
+}
+
+// exportProgress reports sales-processed / slices-completed / ETA to
+// stderr as a chunked export runs.
+type exportProgress struct {
+	bar         *progressbar.ProgressBar
+	mu          sync.Mutex
+	sales       int
+	totalSlices int
+}
+
+func newExportProgress(totalSlices int) *exportProgress {
+	bar := progressbar.NewOptions(totalSlices,
+		progressbar.OptionSetWriter(os.Stderr),
+		progressbar.OptionSetDescription("Exporting sales (0 sales written)"),
+		progressbar.OptionShowCount(),
+		progressbar.OptionThrottle(2*time.Second),
+		progressbar.OptionSetPredictTime(true),
+	)
+	return &exportProgress{bar: bar, totalSlices: totalSlices}
+}
+
+// SliceDone marks one date-range slice as fetched and written.
+func (p *exportProgress) SliceDone() {
+	p.bar.Add(1)
+}
+
+// SaleWritten marks one sale as written to the report file, and refreshes
+// the progress bar's description so the periodic stderr line shows sales
+// processed alongside slices completed and ETA.
+func (p *exportProgress) SaleWritten() {
+	p.mu.Lock()
+	p.sales++
+	p.bar.Describe(fmt.Sprintf("Exporting sales (%d sales written)", p.sales))
+	p.mu.Unlock()
+}
+
+func (p *exportProgress) SalesWritten() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.sales
+}
+
+func (p *exportProgress) Finish() {
+	p.bar.Finish()
+}
+
+// chunkResult is the outcome of fetching and denormalizing one date-range
+// slice, tagged with its position in the original chunk list so results can
+// be written back out in chronological order regardless of which worker
+// finished first.
+type chunkResult struct {
+	index   int
+	reports []SaleReport
+	err     error
+}
+
+// salesSearcher is the subset of *vend.Client that streamSalesReport needs,
+// narrowed so tests can exercise the streaming/reassembly logic with a fake
+// implementation instead of a real Vend API client.
+type salesSearcher interface {
+	SalesSearch(dateFrom, dateTo, outlet string) ([]vend.Sale, error)
+}
+
+// streamSalesReport fetches chunks concurrently across workers, rate
+// limited by bucket, computes each sale's report, and writes sales to
+// renderer in the same chronological order a single sequential SalesSearch
+// call would have produced - matching the order Vend's own sales history
+// export uses - even though the underlying fetches complete out of order.
+// registers/users/customers/products are fetched once by the caller and
+// shared read-only across workers.
+func streamSalesReport(vc salesSearcher, timeZone string, chunks []dateChunk, outlet string, workers int, bucket *tokenBucket,
+	registers []vend.Register, users []vend.User, customers []vend.Customer, products []vend.Product,
+	renderer SalesRenderer, progress *exportProgress) error {
+
+	type indexedChunk struct {
+		index int
+		chunk dateChunk
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	chunkCh := make(chan indexedChunk)
+	resultCh := make(chan chunkResult)
+
+	var workerWG sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		workerWG.Add(1)
+		go func() {
+			defer workerWG.Done()
+			for ic := range chunkCh {
+				bucket.Take()
+				sales, err := vc.SalesSearch(ic.chunk.From, ic.chunk.To, outlet)
+				if err != nil {
+					resultCh <- chunkResult{index: ic.index, err: fmt.Errorf("slice %s to %s: %w", ic.chunk.From, ic.chunk.To, err)}
+					continue
+				}
+				reports := calculateSalesReport(registers, users, customers, products, sales, timeZone)
+				resultCh <- chunkResult{index: ic.index, reports: reports}
+			}
+		}()
+	}
+
+	go func() {
+		for i, chunk := range chunks {
+			chunkCh <- indexedChunk{index: i, chunk: chunk}
+		}
+		close(chunkCh)
+	}()
+
+	go func() {
+		workerWG.Wait()
+		close(resultCh)
+	}()
+
+	// Buffer out-of-order results until the chunk they belong to is next in
+	// line, then flush them to renderer - one writer, rows appended as soon
+	// as their turn comes up rather than all buffered to the end.
+	pending := make(map[int][]SaleReport)
+	nextIndex := 0
+	var writeErr error
+
+	for result := range resultCh {
+		progress.SliceDone()
+		if writeErr == nil && result.err != nil {
+			writeErr = result.err
+		}
+		pending[result.index] = result.reports
+
+		for {
+			reports, ok := pending[nextIndex]
+			if !ok {
+				break
+			}
+			delete(pending, nextIndex)
+			nextIndex++
+
+			if writeErr != nil {
+				continue
+			}
+			for _, report := range reports {
+				if err := renderer.WriteSale(report); err != nil {
+					writeErr = err
+					break
+				}
+				progress.SaleWritten()
+			}
+		}
+	}
+
+	return writeErr
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jackharrisonsherlock/govend/vend"
+)
+
+func TestChunkDateRange_BoundaryChunk(t *testing.T) {
+	chunks, err := chunkDateRange("2023-01-01", "2023-01-14", 7)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []dateChunk{
+		{From: "2023-01-01", To: "2023-01-07"},
+		{From: "2023-01-08", To: "2023-01-14"},
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("got %d chunks, want %d: %+v", len(chunks), len(want), chunks)
+	}
+	for i, c := range chunks {
+		if c != want[i] {
+			t.Errorf("chunk %d = %+v, want %+v", i, c, want[i])
+		}
+	}
+}
+
+func TestChunkDateRange_SingleDayRange(t *testing.T) {
+	chunks, err := chunkDateRange("2023-01-01", "2023-01-01", 7)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(chunks) != 1 {
+		t.Fatalf("got %d chunks, want 1", len(chunks))
+	}
+	if chunks[0] != (dateChunk{From: "2023-01-01", To: "2023-01-01"}) {
+		t.Errorf("chunk = %+v, want {2023-01-01 2023-01-01}", chunks[0])
+	}
+}
+
+func TestChunkDateRange_NonMultipleOfChunkDays(t *testing.T) {
+	chunks, err := chunkDateRange("2023-01-01", "2023-01-10", 7)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []dateChunk{
+		{From: "2023-01-01", To: "2023-01-07"},
+		{From: "2023-01-08", To: "2023-01-10"},
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("got %d chunks, want %d: %+v", len(chunks), len(want), chunks)
+	}
+	for i, c := range chunks {
+		if c != want[i] {
+			t.Errorf("chunk %d = %+v, want %+v", i, c, want[i])
+		}
+	}
+}
+
+// fakeSearcher returns one sale per chunk, keyed by its From date, and
+// deliberately answers earlier chunks slower than later ones so a
+// streamSalesReport test can tell whether output ordering actually comes
+// from the chunk index rather than fetch completion order.
+type fakeSearcher struct {
+	delay map[string]time.Duration
+}
+
+func (f *fakeSearcher) SalesSearch(dateFrom, dateTo, outlet string) ([]vend.Sale, error) {
+	if d, ok := f.delay[dateFrom]; ok {
+		time.Sleep(d)
+	}
+	return []vend.Sale{
+		{
+			SaleDate:      strp(dateFrom + "T10:00:00+00:00"),
+			InvoiceNumber: strp(dateFrom),
+			RegisterID:    strp("reg-1"),
+			Status:        strp("CLOSED"),
+			TotalPrice:    f64p(10),
+			TotalTax:      f64p(0),
+			TotalLoyalty:  f64p(0),
+			LineItems:     &[]vend.SaleLineItem{},
+			Payments:      &[]vend.Payment{},
+		},
+	}, nil
+}
+
+// fakeRenderer records the order sales are written in, without touching disk.
+type fakeRenderer struct {
+	invoiceNumbers []string
+}
+
+func (f *fakeRenderer) WriteHeader() error { return nil }
+
+func (f *fakeRenderer) WriteSale(report SaleReport) error {
+	f.invoiceNumbers = append(f.invoiceNumbers, report.Header.InvoiceNumber)
+	return nil
+}
+
+func (f *fakeRenderer) Close() (string, error) { return "", nil }
+
+func TestStreamSalesReport_WritesInChronologicalChunkOrder(t *testing.T) {
+	chunks := []dateChunk{
+		{From: "2023-01-01", To: "2023-01-01"},
+		{From: "2023-01-02", To: "2023-01-02"},
+		{From: "2023-01-03", To: "2023-01-03"},
+	}
+	// The earliest chunk is the slowest to fetch, so a naive
+	// write-as-it-arrives implementation would write it last.
+	searcher := &fakeSearcher{delay: map[string]time.Duration{
+		"2023-01-01": 30 * time.Millisecond,
+		"2023-01-02": 15 * time.Millisecond,
+	}}
+	renderer := &fakeRenderer{}
+	registers, users, customers, products := baseLookups()
+	bucket := newTokenBucket(1000)
+	defer bucket.Close()
+	progress := newExportProgress(len(chunks))
+
+	err := streamSalesReport(searcher, "Pacific/Auckland", chunks, "", 3, bucket,
+		registers, users, customers, products, renderer, progress)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"2023-01-01", "2023-01-02", "2023-01-03"}
+	if len(renderer.invoiceNumbers) != len(want) {
+		t.Fatalf("got %v, want %v", renderer.invoiceNumbers, want)
+	}
+	for i, invoice := range renderer.invoiceNumbers {
+		if invoice != want[i] {
+			t.Errorf("invoiceNumbers[%d] = %q, want %q (sales written out of chronological order)", i, invoice, want[i])
+		}
+	}
+}
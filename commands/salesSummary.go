@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SummaryGroupKey is one dimension a --summary report can be grouped by.
+type SummaryGroupKey string
+
+// Supported summary grouping dimensions.
+const (
+	GroupByRegister SummaryGroupKey = "by-register"
+	GroupByUser     SummaryGroupKey = "by-user"
+	GroupByProduct  SummaryGroupKey = "by-product"
+	GroupByDay      SummaryGroupKey = "by-day"
+)
+
+var summaryGroupOrder = []SummaryGroupKey{GroupByRegister, GroupByUser, GroupByProduct, GroupByDay}
+
+// parseSummaryGroupBy validates and splits the comma-separated value of the
+// --summary flag, e.g. "by-user,by-day".
+func parseSummaryGroupBy(value string) ([]SummaryGroupKey, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	var keys []SummaryGroupKey
+	for _, part := range strings.Split(value, ",") {
+		key := SummaryGroupKey(strings.TrimSpace(part))
+		valid := false
+		for _, known := range summaryGroupOrder {
+			if key == known {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("unsupported --summary grouping: %q (expected by-register, by-user, by-product, or by-day)", part)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// SummaryRow is one aggregated row of a --summary report: all sales (or, when
+// grouping by-product, sale lines) sharing the same combination of grouping
+// values, rolled up into totals.
+type SummaryRow struct {
+	GroupValues      map[SummaryGroupKey]string
+	Count            int
+	TotalQuantity    float64
+	TotalDiscount    float64
+	TotalLoyalty     float64
+	Subtotal         float64
+	Tax              float64
+	Total            float64
+	PaymentBreakdown map[string]float64
+}
+
+// GroupLabel renders the row's grouping values in groupBy order, e.g.
+// "2023-06-01 / Jane Smith".
+func (r SummaryRow) GroupLabel(groupBy []SummaryGroupKey) string {
+	var parts []string
+	for _, key := range groupBy {
+		parts = append(parts, r.GroupValues[key])
+	}
+	return strings.Join(parts, " / ")
+}
+
+// buildSalesSummary aggregates reports by the requested grouping dimensions.
+//
+// Payments belong to a sale, not to any one of its line items, so when
+// by-product is one of the grouping dimensions, aggregation happens per
+// sale line instead of per sale, and PaymentBreakdown is left empty: a
+// sale's payments can't be meaningfully split across its product lines.
+func buildSalesSummary(reports []SaleReport, groupBy []SummaryGroupKey) []SummaryRow {
+	rows := make(map[string]*SummaryRow)
+	var order []string
+
+	groupsByProduct := containsKey(groupBy, GroupByProduct)
+
+	addRow := func(key string, values map[SummaryGroupKey]string) *SummaryRow {
+		row, ok := rows[key]
+		if !ok {
+			row = &SummaryRow{GroupValues: values, PaymentBreakdown: map[string]float64{}}
+			rows[key] = row
+			order = append(order, key)
+		}
+		return row
+	}
+
+	for _, report := range reports {
+		h := report.Header
+
+		if !groupsByProduct {
+			values := groupValues(groupBy, h, "")
+			row := addRow(groupKey(values, groupBy), values)
+			row.Count++
+			row.TotalQuantity += h.TotalQuantity
+			row.TotalDiscount += h.Discount
+			row.TotalLoyalty += h.Loyalty
+			row.Subtotal += h.Subtotal
+			row.Tax += h.Tax
+			row.Total += h.Total
+			for _, payment := range report.Payments {
+				row.PaymentBreakdown[payment.Name] += payment.Amount
+			}
+			continue
+		}
+
+		for _, line := range report.Lines {
+			values := groupValues(groupBy, h, line.ProductName)
+			row := addRow(groupKey(values, groupBy), values)
+			row.Count++
+			row.TotalQuantity += line.Quantity
+			row.TotalDiscount += line.DiscountTotal
+			row.TotalLoyalty += line.Loyalty
+			row.Subtotal += line.Price * line.Quantity
+			row.Tax += line.Tax * line.Quantity
+			row.Total += line.Total
+		}
+	}
+
+	sort.Strings(order)
+
+	summary := make([]SummaryRow, 0, len(order))
+	for _, key := range order {
+		summary = append(summary, *rows[key])
+	}
+	return summary
+}
+
+func containsKey(groupBy []SummaryGroupKey, key SummaryGroupKey) bool {
+	for _, k := range groupBy {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// groupValues resolves the value of each requested grouping dimension for a
+// sale (and, for by-product, one of its lines).
+func groupValues(groupBy []SummaryGroupKey, h SaleHeader, productName string) map[SummaryGroupKey]string {
+	values := make(map[SummaryGroupKey]string, len(groupBy))
+	for _, key := range groupBy {
+		switch key {
+		case GroupByRegister:
+			values[key] = h.Register
+		case GroupByUser:
+			values[key] = h.User
+		case GroupByDay:
+			values[key] = h.SaleDate
+		case GroupByProduct:
+			values[key] = productName
+		}
+	}
+	return values
+}
+
+// groupKey builds a stable map key from values, ordered by groupBy so that
+// the same combination of values always hashes to the same row.
+func groupKey(values map[SummaryGroupKey]string, groupBy []SummaryGroupKey) string {
+	parts := make([]string, len(groupBy))
+	for i, key := range groupBy {
+		parts[i] = values[key]
+	}
+	return strings.Join(parts, "\x1f")
+}
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/tealeg/xlsx"
+)
+
+// writeSalesSummary writes summary rows, grouped by groupBy, to a report file
+// named after domainPrefix in the requested format, and returns the file's
+// name.
+func writeSalesSummary(format ReportFormat, domainPrefix string, groupBy []SummaryGroupKey, rows []SummaryRow) (string, error) {
+	fileName := fmt.Sprintf("%s_sales_summary_%v.%s", domainPrefix, time.Now().Unix(), format)
+
+	switch format {
+	case FormatCSV:
+		return fileName, writeSummaryDelimited(fileName, ',', groupBy, rows)
+	case FormatTSV:
+		return fileName, writeSummaryDelimited(fileName, '\t', groupBy, rows)
+	case FormatXLSX:
+		return fileName, writeSummaryXLSX(fileName, groupBy, rows)
+	case FormatJSON:
+		return fileName, writeSummaryJSON(fileName, groupBy, rows)
+	default:
+		return "", fmt.Errorf("unsupported format: %q", format)
+	}
+}
+
+// summaryHeader returns the column headers for a summary report: the
+// requested grouping dimensions, followed by the fixed set of totals.
+func summaryHeader(groupBy []SummaryGroupKey) []string {
+	header := make([]string, 0, len(groupBy)+7)
+	for _, key := range groupBy {
+		header = append(header, string(key))
+	}
+	return append(header, "Count", "Total Quantity", "Subtotal", "Tax", "Total Discount", "Total Loyalty", "Total")
+}
+
+// summaryRecord flattens a SummaryRow into a row matching summaryHeader's
+// columns. Payment breakdown isn't a fixed-width field, so it's appended
+// after them as one extra "method: amount, ..." column, which callers head
+// with "Payment Breakdown".
+func summaryRecord(groupBy []SummaryGroupKey, row SummaryRow) []string {
+	record := make([]string, 0, len(groupBy)+8)
+	for _, key := range groupBy {
+		record = append(record, row.GroupValues[key])
+	}
+	record = append(record,
+		fmt.Sprintf("%d", row.Count),
+		formatFloat(row.TotalQuantity),
+		formatFloat(row.Subtotal),
+		formatFloat(row.Tax),
+		formatFloat(row.TotalDiscount),
+		formatFloat(row.TotalLoyalty),
+		formatFloat(row.Total),
+		formatPaymentBreakdown(row.PaymentBreakdown),
+	)
+	return record
+}
+
+func formatPaymentBreakdown(breakdown map[string]float64) string {
+	if len(breakdown) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(breakdown))
+	for name := range breakdown {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s: %s", name, formatFloat(breakdown[name])))
+	}
+	out := parts[0]
+	for _, part := range parts[1:] {
+		out += ", " + part
+	}
+	return out
+}
+
+func writeSummaryDelimited(fileName string, comma rune, groupBy []SummaryGroupKey, rows []SummaryRow) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", fileName, err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Comma = comma
+
+	header := summaryHeader(groupBy)
+	header = append(header, "Payment Breakdown")
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := writer.Write(summaryRecord(groupBy, row)); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeSummaryXLSX(fileName string, groupBy []SummaryGroupKey, rows []SummaryRow) error {
+	file := xlsx.NewFile()
+	sheet, err := file.AddSheet("Summary")
+	if err != nil {
+		return fmt.Errorf("error creating Summary sheet: %w", err)
+	}
+
+	header := summaryHeader(groupBy)
+	header = append(header, "Payment Breakdown")
+	writeXLSXRow(sheet, header)
+	for _, row := range rows {
+		writeXLSXRow(sheet, summaryRecord(groupBy, row))
+	}
+
+	return file.Save(fileName)
+}
+
+// summaryEnvelope is the JSON representation of a single summary row.
+type summaryEnvelope struct {
+	Group            map[string]string  `json:"group"`
+	Count            int                `json:"count"`
+	TotalQuantity    float64            `json:"total_quantity"`
+	Subtotal         float64            `json:"subtotal"`
+	Tax              float64            `json:"tax"`
+	TotalDiscount    float64            `json:"total_discount"`
+	TotalLoyalty     float64            `json:"total_loyalty"`
+	Total            float64            `json:"total"`
+	PaymentBreakdown map[string]float64 `json:"payment_breakdown,omitempty"`
+}
+
+func writeSummaryJSON(fileName string, groupBy []SummaryGroupKey, rows []SummaryRow) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", fileName, err)
+	}
+	defer file.Close()
+
+	envelopes := make([]summaryEnvelope, 0, len(rows))
+	for _, row := range rows {
+		group := make(map[string]string, len(groupBy))
+		for _, key := range groupBy {
+			group[string(key)] = row.GroupValues[key]
+		}
+		envelopes = append(envelopes, summaryEnvelope{
+			Group:            group,
+			Count:            row.Count,
+			TotalQuantity:    row.TotalQuantity,
+			Subtotal:         row.Subtotal,
+			Tax:              row.Tax,
+			TotalDiscount:    row.TotalDiscount,
+			TotalLoyalty:     row.TotalLoyalty,
+			Total:            row.Total,
+			PaymentBreakdown: row.PaymentBreakdown,
+		})
+	}
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(envelopes)
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import "testing"
+
+func baseSaleReport() SaleReport {
+	return SaleReport{
+		Header: SaleHeader{
+			Register:      "Front Counter",
+			User:          "Jane Smith",
+			SaleDate:      "2023-06-01",
+			TotalQuantity: 2,
+			Discount:      0,
+			Loyalty:       0,
+			Subtotal:      100,
+			Tax:           15,
+			Total:         115,
+		},
+		Lines: []LineReport{
+			{ProductName: "Widget - Red", Quantity: 2, Price: 50, Tax: 7.5, Discount: 0, Loyalty: 0, Total: 115},
+		},
+		Payments: []PaymentReport{
+			{Name: "Cash", Amount: 115},
+		},
+	}
+}
+
+func TestBuildSalesSummary_GroupByRegister(t *testing.T) {
+	reportA := baseSaleReport()
+	reportB := baseSaleReport()
+	reportB.Header.Register = "Back Counter"
+	reportB.Header.Total = 50
+	reportB.Payments = []PaymentReport{{Name: "Cash", Amount: 50}}
+
+	rows := buildSalesSummary([]SaleReport{reportA, reportB}, []SummaryGroupKey{GroupByRegister})
+
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(rows))
+	}
+
+	var backCounter *SummaryRow
+	for i := range rows {
+		if rows[i].GroupValues[GroupByRegister] == "Back Counter" {
+			backCounter = &rows[i]
+		}
+	}
+	if backCounter == nil {
+		t.Fatalf("no row for Back Counter")
+	}
+	if backCounter.Count != 1 {
+		t.Errorf("count = %d, want 1", backCounter.Count)
+	}
+	if backCounter.Total != 50 {
+		t.Errorf("total = %v, want 50", backCounter.Total)
+	}
+	if backCounter.PaymentBreakdown["Cash"] != 50 {
+		t.Errorf("payment breakdown[Cash] = %v, want 50", backCounter.PaymentBreakdown["Cash"])
+	}
+}
+
+func TestBuildSalesSummary_SameGroupAggregates(t *testing.T) {
+	reportA := baseSaleReport()
+	reportB := baseSaleReport()
+
+	rows := buildSalesSummary([]SaleReport{reportA, reportB}, []SummaryGroupKey{GroupByRegister})
+
+	if len(rows) != 1 {
+		t.Fatalf("got %d rows, want 1", len(rows))
+	}
+	row := rows[0]
+	if row.Count != 2 {
+		t.Errorf("count = %d, want 2", row.Count)
+	}
+	if row.Total != 230 {
+		t.Errorf("total = %v, want 230", row.Total)
+	}
+	if row.PaymentBreakdown["Cash"] != 230 {
+		t.Errorf("payment breakdown[Cash] = %v, want 230", row.PaymentBreakdown["Cash"])
+	}
+}
+
+func TestBuildSalesSummary_GroupByProduct_AggregatesPerLineAndOmitsPayments(t *testing.T) {
+	report := baseSaleReport()
+	report.Lines = append(report.Lines, LineReport{ProductName: "Gadget", Quantity: 1, Price: 20, Tax: 3, Total: 23})
+
+	rows := buildSalesSummary([]SaleReport{report}, []SummaryGroupKey{GroupByProduct})
+
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(rows))
+	}
+	for _, row := range rows {
+		if row.Count != 1 {
+			t.Errorf("count for %q = %d, want 1", row.GroupValues[GroupByProduct], row.Count)
+		}
+		if len(row.PaymentBreakdown) != 0 {
+			t.Errorf("payment breakdown for %q = %v, want empty (payments can't be split per product)", row.GroupValues[GroupByProduct], row.PaymentBreakdown)
+		}
+	}
+}
+
+// TestBuildSalesSummary_TotalDiscountUsesDiscountTotalRegardlessOfGrouping
+// guards against TotalDiscount being computed from a different underlying
+// quantity (Discount vs. DiscountTotal) depending on whether by-product is
+// one of the grouping dimensions - they should always agree.
+func TestBuildSalesSummary_TotalDiscountUsesDiscountTotalRegardlessOfGrouping(t *testing.T) {
+	report := baseSaleReport()
+	report.Header.Discount = 9
+	report.Lines[0].Discount = 2
+	report.Lines[0].DiscountTotal = 9
+
+	withoutProduct := buildSalesSummary([]SaleReport{report}, []SummaryGroupKey{GroupByRegister})
+	withProduct := buildSalesSummary([]SaleReport{report}, []SummaryGroupKey{GroupByProduct})
+
+	if withoutProduct[0].TotalDiscount != 9 {
+		t.Errorf("by-register total discount = %v, want 9", withoutProduct[0].TotalDiscount)
+	}
+	if withProduct[0].TotalDiscount != 9 {
+		t.Errorf("by-product total discount = %v, want 9 (DiscountTotal, not the plain Discount field)", withProduct[0].TotalDiscount)
+	}
+}
+
+func TestBuildSalesSummary_MultipleGroupKeysCompose(t *testing.T) {
+	reportA := baseSaleReport()
+	reportB := baseSaleReport()
+	reportB.Header.SaleDate = "2023-06-02"
+
+	rows := buildSalesSummary([]SaleReport{reportA, reportB}, []SummaryGroupKey{GroupByUser, GroupByDay})
+
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(rows))
+	}
+	for _, row := range rows {
+		if row.GroupValues[GroupByUser] != "Jane Smith" {
+			t.Errorf("user = %q, want Jane Smith", row.GroupValues[GroupByUser])
+		}
+	}
+}
+
+func TestGroupKey_SameValuesSameKey(t *testing.T) {
+	groupBy := []SummaryGroupKey{GroupByUser, GroupByDay}
+	values1 := map[SummaryGroupKey]string{GroupByUser: "Jane Smith", GroupByDay: "2023-06-01"}
+	values2 := map[SummaryGroupKey]string{GroupByUser: "Jane Smith", GroupByDay: "2023-06-01"}
+
+	if groupKey(values1, groupBy) != groupKey(values2, groupBy) {
+		t.Errorf("expected identical group values to produce the same key")
+	}
+
+	values3 := map[SummaryGroupKey]string{GroupByUser: "Jane Smith", GroupByDay: "2023-06-02"}
+	if groupKey(values1, groupBy) == groupKey(values3, groupBy) {
+		t.Errorf("expected different group values to produce different keys")
+	}
+}